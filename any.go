@@ -0,0 +1,194 @@
+package packed
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Type tags used by WriteAny/ReadAny to self-describe a value on the wire.
+// Tags below TYPE_USER are reserved for the built-in kinds below; user
+// types registered via RegisterType must use a tag >= TYPE_USER.
+const (
+	TYPE_NIL uint8 = iota
+	TYPE_INT8
+	TYPE_INT16
+	TYPE_INT32
+	TYPE_INT64
+	TYPE_UINT8
+	TYPE_UINT16
+	TYPE_UINT32
+	TYPE_UINT64
+	TYPE_STRING
+	TYPE_BYTES
+	TYPE_FLOAT32
+	TYPE_FLOAT64
+	TYPE_ARRAY
+	TYPE_OBJECT
+	TYPE_BOOL
+
+	// TYPE_USER is the first tag value available to RegisterType.
+	TYPE_USER uint8 = 32
+)
+
+var typeRegistry = map[uint8]func() Serializable{}
+var tagByType = map[reflect.Type]uint8{}
+
+// RegisterType associates tag with factory so that ReadAny can construct a
+// fresh Serializable when it encounters tag on the wire, and so WriteAny can
+// find the right tag for a value of the type factory produces. tag must be
+// >= TYPE_USER.
+func RegisterType(tag uint8, factory func() Serializable) {
+	if tag < TYPE_USER {
+		panic(fmt.Errorf("packed: RegisterType tag %d collides with a built-in TYPE_ constant", tag))
+	}
+	typeRegistry[tag] = factory
+	tagByType[reflect.TypeOf(factory())] = tag
+}
+
+// WriteAny writes v prefixed with a 1-byte type tag, so that ReadAny can
+// reconstruct it without the reader knowing its type ahead of time. v must
+// be nil, one of the fixed-width numeric kinds, bool, string, []byte,
+// []interface{}, map[string]interface{}, or a Serializable registered via
+// RegisterType.
+func WriteAny(out Output, v interface{}) {
+	switch val := v.(type) {
+	case nil:
+		out.WriteUint8(TYPE_NIL)
+	case bool:
+		out.WriteUint8(TYPE_BOOL)
+		out.WriteUint8(boolByte(val))
+	case int8:
+		out.WriteUint8(TYPE_INT8)
+		out.WriteInt8(val)
+	case int16:
+		out.WriteUint8(TYPE_INT16)
+		out.WriteInt16(val)
+	case int32:
+		out.WriteUint8(TYPE_INT32)
+		out.WriteInt32(val)
+	case int64:
+		out.WriteUint8(TYPE_INT64)
+		out.WriteInt64(val)
+	case int:
+		out.WriteUint8(TYPE_INT64)
+		out.WriteInt64(int64(val))
+	case uint8:
+		out.WriteUint8(TYPE_UINT8)
+		out.WriteUint8(val)
+	case uint16:
+		out.WriteUint8(TYPE_UINT16)
+		out.WriteUint16(val)
+	case uint32:
+		out.WriteUint8(TYPE_UINT32)
+		out.WriteUint32(val)
+	case uint64:
+		out.WriteUint8(TYPE_UINT64)
+		out.WriteUint64(val)
+	case uint:
+		out.WriteUint8(TYPE_UINT64)
+		out.WriteUint64(uint64(val))
+	case float32:
+		out.WriteUint8(TYPE_FLOAT32)
+		out.WriteFloat32(val)
+	case float64:
+		out.WriteUint8(TYPE_FLOAT64)
+		out.WriteFloat64(val)
+	case string:
+		out.WriteUint8(TYPE_STRING)
+		out.WriteString(val)
+	case []byte:
+		out.WriteUint8(TYPE_BYTES)
+		out.WriteBytes(val)
+	case []interface{}:
+		out.WriteUint8(TYPE_ARRAY)
+		out.WriteVarUint32(uint32(len(val)))
+		for _, elem := range val {
+			WriteAny(out, elem)
+		}
+	case map[string]interface{}:
+		out.WriteUint8(TYPE_OBJECT)
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out.WriteVarUint32(uint32(len(keys)))
+		for _, key := range keys {
+			out.WriteString(key)
+			WriteAny(out, val[key])
+		}
+	default:
+		s, ok := v.(Serializable)
+		if !ok {
+			panic(fmt.Errorf("packed: WriteAny: %T is not registered via RegisterType", v))
+		}
+		tag, ok := tagByType[reflect.TypeOf(v)]
+		if !ok {
+			panic(fmt.Errorf("packed: WriteAny: %T is not registered via RegisterType", v))
+		}
+		out.WriteUint8(tag)
+		s.Save(out)
+	}
+}
+
+// ReadAny reads a value written by WriteAny, dispatching on its leading
+// type tag. User types must have been registered with RegisterType before
+// ReadAny can reconstruct them.
+func ReadAny(in Input) interface{} {
+	switch tag := in.ReadUint8(); tag {
+	case TYPE_NIL:
+		return nil
+	case TYPE_INT8:
+		return in.ReadInt8()
+	case TYPE_INT16:
+		return in.ReadInt16()
+	case TYPE_INT32:
+		return in.ReadInt32()
+	case TYPE_INT64:
+		return in.ReadInt64()
+	case TYPE_UINT8:
+		return in.ReadUint8()
+	case TYPE_BOOL:
+		return in.ReadUint8() != 0
+	case TYPE_UINT16:
+		return in.ReadUint16()
+	case TYPE_UINT32:
+		return in.ReadUint32()
+	case TYPE_UINT64:
+		return in.ReadUint64()
+	case TYPE_FLOAT32:
+		return in.ReadFloat32()
+	case TYPE_FLOAT64:
+		return in.ReadFloat64()
+	case TYPE_STRING:
+		return in.ReadString()
+	case TYPE_BYTES:
+		return in.ReadBytes()
+	case TYPE_ARRAY:
+		length := in.ReadVarUint32()
+		in.checkLength(length)
+		arr := make([]interface{}, length)
+		for i := range arr {
+			arr[i] = ReadAny(in)
+		}
+		return arr
+	case TYPE_OBJECT:
+		length := in.ReadVarUint32()
+		in.checkLength(length)
+		obj := make(map[string]interface{}, length)
+		for i := uint32(0); i < length; i++ {
+			key := in.ReadString()
+			obj[key] = ReadAny(in)
+		}
+		return obj
+	default:
+		factory, ok := typeRegistry[tag]
+		if !ok {
+			panic(fmt.Errorf("packed: ReadAny: unregistered type tag %d", tag))
+		}
+		value := factory()
+		value.Load(in)
+		return value
+	}
+}
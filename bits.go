@@ -0,0 +1,126 @@
+package packed
+
+// BitOutput packs sub-byte fields into an existing Output, buffering bits
+// in an internal accumulator and flushing whole bytes as they fill up.
+// Call AlignToByte before switching back to byte-aligned Output writes.
+type BitOutput struct {
+	out   Output
+	acc   uint64
+	nbits uint
+}
+
+// MakeBitOutput wraps out in a BitOutput.
+func MakeBitOutput(out Output) *BitOutput {
+	return &BitOutput{out: out}
+}
+
+// WriteBits writes the low n bits of v, least-significant bit first.
+func (b *BitOutput) WriteBits(v uint64, n uint) {
+	for n > 32 {
+		b.writeChunk(uint32(v), 32)
+		v >>= 32
+		n -= 32
+	}
+	b.writeChunk(uint32(v), n)
+}
+
+func (b *BitOutput) writeChunk(v uint32, n uint) {
+	if n == 0 {
+		return
+	}
+	mask := uint64(1)<<n - 1
+	b.acc |= (uint64(v) & mask) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.out.WriteUint8(uint8(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+// WriteSignedBits writes the low n bits of v's two's-complement
+// representation, so a matching ReadSignedBits(n) sign-extends it back.
+func (b *BitOutput) WriteSignedBits(v int64, n uint) {
+	b.WriteBits(uint64(v), n)
+}
+
+// WriteBool writes a single bit. Consecutive WriteBool calls coalesce into
+// the same byte via the accumulator.
+func (b *BitOutput) WriteBool(v bool) {
+	b.WriteBits(uint64(boolByte(v)), 1)
+}
+
+// AlignToByte pads any partially-filled byte with zero bits and flushes it,
+// so subsequent writes through the wrapped Output start on a byte boundary.
+func (b *BitOutput) AlignToByte() {
+	if b.nbits > 0 {
+		b.out.WriteUint8(uint8(b.acc))
+		b.acc = 0
+		b.nbits = 0
+	}
+}
+
+// BitInput unpacks sub-byte fields from an existing Input, buffering bits
+// read from it in an internal accumulator. Call AlignToByte before
+// switching back to byte-aligned Input reads.
+type BitInput struct {
+	in    Input
+	acc   uint64
+	nbits uint
+}
+
+// MakeBitInput wraps in in a BitInput.
+func MakeBitInput(in Input) *BitInput {
+	return &BitInput{in: in}
+}
+
+// ReadBits reads n bits, least-significant bit first, as written by
+// WriteBits.
+func (b *BitInput) ReadBits(n uint) uint64 {
+	var result uint64
+	var shift uint
+	for n > 0 {
+		take := n
+		if take > 32 {
+			take = 32
+		}
+		result |= uint64(b.readChunk(take)) << shift
+		shift += take
+		n -= take
+	}
+	return result
+}
+
+func (b *BitInput) readChunk(n uint) uint32 {
+	for b.nbits < n {
+		b.acc |= uint64(b.in.ReadUint8()) << b.nbits
+		b.nbits += 8
+	}
+	mask := uint64(1)<<n - 1
+	value := uint32(b.acc & mask)
+	b.acc >>= n
+	b.nbits -= n
+	return value
+}
+
+// ReadSignedBits reads n bits written by WriteSignedBits and sign-extends
+// the result to a full int64.
+func (b *BitInput) ReadSignedBits(n uint) int64 {
+	value := b.ReadBits(n)
+	if n < 64 && n > 0 && value&(1<<(n-1)) != 0 {
+		value |= ^uint64(0) << n
+	}
+	return int64(value)
+}
+
+// ReadBool reads a single bit written by WriteBool.
+func (b *BitInput) ReadBool() bool {
+	return b.ReadBits(1) != 0
+}
+
+// AlignToByte discards any bits buffered from a partially-consumed byte, so
+// subsequent reads through the wrapped Input resume on a byte boundary.
+func (b *BitInput) AlignToByte() {
+	b.acc = 0
+	b.nbits = 0
+}
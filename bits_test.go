@@ -0,0 +1,86 @@
+package packed
+
+import "testing"
+
+func TestBitOutputInputRoundTrip(t *testing.T) {
+	out, buf := NewOutput()
+	bo := MakeBitOutput(out)
+	bo.WriteBits(0b101, 3)
+	bo.WriteSignedBits(-5, 8)
+	bo.WriteBool(true)
+	bo.WriteBool(false)
+	bo.WriteBool(true)
+	bo.AlignToByte()
+	out.WriteUint32(42)
+
+	in := InputFromBuffer(buf.Bytes())
+	bi := MakeBitInput(in)
+	if v := bi.ReadBits(3); v != 0b101 {
+		t.Fatalf("ReadBits(3) = %v, want 5", v)
+	}
+	if v := bi.ReadSignedBits(8); v != -5 {
+		t.Fatalf("ReadSignedBits(8) = %v, want -5", v)
+	}
+	if v := bi.ReadBool(); !v {
+		t.Fatalf("ReadBool() #1 = %v, want true", v)
+	}
+	if v := bi.ReadBool(); v {
+		t.Fatalf("ReadBool() #2 = %v, want false", v)
+	}
+	if v := bi.ReadBool(); !v {
+		t.Fatalf("ReadBool() #3 = %v, want true", v)
+	}
+	bi.AlignToByte()
+	if v := in.ReadUint32(); v != 42 {
+		t.Fatalf("trailing ReadUint32() = %v, want 42 (bit stream desynced byte-aligned reads)", v)
+	}
+}
+
+// TestBitsWideFields exercises WriteBits/ReadBits past the 32-bit chunk
+// boundary writeChunk/readChunk split on, including the full 64-bit width.
+func TestBitsWideFields(t *testing.T) {
+	cases := []struct {
+		value uint64
+		bits  uint
+	}{
+		{0, 33},
+		{1, 33},
+		{1 << 32, 33},
+		{^uint64(0), 64},
+		{^uint64(0) >> 1, 63},
+		{0x0102030405060708, 64},
+	}
+	for _, c := range cases {
+		out, buf := NewOutput()
+		bo := MakeBitOutput(out)
+		bo.WriteBits(c.value, c.bits)
+		bo.AlignToByte()
+
+		in := InputFromBuffer(buf.Bytes())
+		bi := MakeBitInput(in)
+		mask := uint64(1)<<c.bits - 1
+		if c.bits == 64 {
+			mask = ^uint64(0)
+		}
+		want := c.value & mask
+		if got := bi.ReadBits(c.bits); got != want {
+			t.Fatalf("WriteBits(%#x, %d) -> ReadBits(%d) = %#x, want %#x", c.value, c.bits, c.bits, got, want)
+		}
+	}
+}
+
+func TestBitOutputAlignToByteWithoutPendingBits(t *testing.T) {
+	out, buf := NewOutput()
+	bo := MakeBitOutput(out)
+	bo.WriteBits(0xFF, 8)
+	bo.AlignToByte() // no pending bits; should be a no-op, not pad an extra byte
+	out.WriteUint8(1)
+
+	in := InputFromBuffer(buf.Bytes())
+	if v := in.ReadUint8(); v != 0xFF {
+		t.Fatalf("got %v, want 0xFF", v)
+	}
+	if v := in.ReadUint8(); v != 1 {
+		t.Fatalf("AlignToByte with no pending bits wrote a spurious byte; got %v, want 1", v)
+	}
+}
@@ -0,0 +1,382 @@
+package packed
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// EUnsupportedType is returned/panicked when Marshal/Unmarshal encounters a
+// Go type it has no wire representation for.
+var EUnsupportedType = errors.New("packed: unsupported type")
+
+var serializableType = reflect.TypeOf((*Serializable)(nil)).Elem()
+
+// Marshal walks v via reflection and writes it to out, guided by `packed`
+// struct tags ("varint", "zigzag", "fixed32", "fixed64", "bytes", "skip").
+// On signed integer fields "varint" is a plain two's-complement varint
+// (like protobuf's int32/int64) while "zigzag" zig-zags the value first so
+// small negative numbers stay compact (like protobuf's sint32/sint64); on
+// unsigned fields the two tags are equivalent. "bytes" on a fixed-size byte
+// array ([N]byte) writes/reads it as a single WriteFixedBytes/ReadFixedBytes
+// call instead of per-element; it has no effect elsewhere ([]byte fields
+// already get this treatment automatically). Types implementing
+// Serializable are written via Save instead of being walked field-by-field.
+// Like the rest of Output, it panics on I/O error.
+func Marshal(out Output, v interface{}) {
+	encodeValue(out, reflect.ValueOf(v), "")
+}
+
+// Unmarshal is the Marshal counterpart: v must be a non-nil pointer. Unlike
+// the panic-based Input methods it underpins, Unmarshal recovers from those
+// panics and reports them as an error.
+func Unmarshal(in Input, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("packed: Unmarshal requires a non-nil pointer, got %T", v)
+	}
+	decodeValue(in, rv.Elem(), "")
+	return nil
+}
+
+func asSerializableSave(rv reflect.Value) (Serializable, bool) {
+	if rv.CanInterface() {
+		if s, ok := rv.Interface().(Serializable); ok {
+			return s, true
+		}
+	}
+	if rv.CanAddr() && rv.Addr().Type().Implements(serializableType) {
+		return rv.Addr().Interface().(Serializable), true
+	}
+	if rv.CanInterface() && reflect.PtrTo(rv.Type()).Implements(serializableType) {
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return ptr.Interface().(Serializable), true
+	}
+	return nil, false
+}
+
+func encodeValue(out Output, rv reflect.Value, tag string) {
+	if tag == "skip" {
+		return
+	}
+	if rv.Kind() == reflect.Ptr {
+		present := !rv.IsNil()
+		out.WriteUint8(boolByte(present))
+		if present {
+			encodeValue(out, rv.Elem(), tag)
+		}
+		return
+	}
+	if s, ok := asSerializableSave(rv); ok {
+		s.Save(out)
+		return
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		encodeStruct(out, rv)
+	case reflect.Slice:
+		if isByteSlice(rv.Type()) {
+			out.WriteBytes(rv.Bytes())
+			return
+		}
+		out.WriteVarUint32(uint32(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			encodeValue(out, rv.Index(i), "")
+		}
+	case reflect.Array:
+		if tag == "bytes" && isByteSlice(rv.Type()) {
+			buf := make([]byte, rv.Len())
+			for i := range buf {
+				buf[i] = byte(rv.Index(i).Uint())
+			}
+			out.WriteFixedBytes(buf)
+			return
+		}
+		for i := 0; i < rv.Len(); i++ {
+			encodeValue(out, rv.Index(i), "")
+		}
+	case reflect.Map:
+		encodeMap(out, rv)
+	case reflect.String:
+		out.WriteString(rv.String())
+	case reflect.Bool:
+		out.WriteUint8(boolByte(rv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeInt(out, rv, tag)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		encodeUint(out, rv, tag)
+	case reflect.Float32:
+		out.WriteFloat32(float32(rv.Float()))
+	case reflect.Float64:
+		out.WriteFloat64(rv.Float())
+	default:
+		panic(EUnsupportedType)
+	}
+}
+
+func encodeStruct(out Output, rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("packed")
+		if tag == "skip" {
+			continue
+		}
+		encodeValue(out, rv.Field(i), tag)
+	}
+}
+
+func encodeMap(out Output, rv reflect.Value) {
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	out.WriteVarUint32(uint32(len(keys)))
+	for _, key := range keys {
+		encodeValue(out, key, "")
+		encodeValue(out, rv.MapIndex(key), "")
+	}
+}
+
+func encodeInt(out Output, rv reflect.Value, tag string) {
+	value := rv.Int()
+	switch tag {
+	case "zigzag":
+		if rv.Type().Bits() > 32 {
+			out.WriteVarInt64(value)
+		} else {
+			out.WriteVarInt32(int32(value))
+		}
+	case "varint":
+		// Plain varint: the two's-complement bit pattern, not zig-zagged,
+		// so a negative value costs the full width (like protobuf int32/64
+		// as opposed to sint32/64). Use "zigzag" for compact negatives.
+		if rv.Type().Bits() > 32 {
+			out.WriteVarUint64(uint64(value))
+		} else {
+			out.WriteVarUint32(uint32(int32(value)))
+		}
+	case "fixed32":
+		out.WriteInt32(int32(value))
+	case "fixed64":
+		out.WriteInt64(value)
+	default:
+		switch rv.Type().Bits() {
+		case 8:
+			out.WriteInt8(int8(value))
+		case 16:
+			out.WriteInt16(int16(value))
+		case 32:
+			out.WriteInt32(int32(value))
+		default:
+			out.WriteInt64(value)
+		}
+	}
+}
+
+func encodeUint(out Output, rv reflect.Value, tag string) {
+	value := rv.Uint()
+	switch tag {
+	case "varint", "zigzag":
+		if rv.Type().Bits() > 32 {
+			out.WriteVarUint64(value)
+		} else {
+			out.WriteVarUint32(uint32(value))
+		}
+	case "fixed32":
+		out.WriteUint32(uint32(value))
+	case "fixed64":
+		out.WriteUint64(value)
+	default:
+		switch rv.Type().Bits() {
+		case 8:
+			out.WriteUint8(uint8(value))
+		case 16:
+			out.WriteUint16(uint16(value))
+		case 32:
+			out.WriteUint32(uint32(value))
+		default:
+			out.WriteUint64(value)
+		}
+	}
+}
+
+func decodeValue(in Input, rv reflect.Value, tag string) {
+	if tag == "skip" {
+		return
+	}
+	if rv.Kind() == reflect.Ptr {
+		if in.ReadUint8() == 0 {
+			rv.Set(reflect.Zero(rv.Type()))
+			return
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		decodeValue(in, rv.Elem(), tag)
+		return
+	}
+	if rv.CanAddr() && rv.Addr().Type().Implements(serializableType) {
+		rv.Addr().Interface().(Serializable).Load(in)
+		return
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		decodeStruct(in, rv)
+	case reflect.Slice:
+		if isByteSlice(rv.Type()) {
+			rv.SetBytes(in.ReadBytes())
+			return
+		}
+		length := in.ReadVarUint32()
+		in.checkLength(length)
+		slice := reflect.MakeSlice(rv.Type(), int(length), int(length))
+		for i := 0; i < int(length); i++ {
+			decodeValue(in, slice.Index(i), "")
+		}
+		rv.Set(slice)
+	case reflect.Array:
+		if tag == "bytes" && isByteSlice(rv.Type()) {
+			buf := make([]byte, rv.Len())
+			in.ReadFixedBytes(buf)
+			for i := range buf {
+				rv.Index(i).SetUint(uint64(buf[i]))
+			}
+			return
+		}
+		for i := 0; i < rv.Len(); i++ {
+			decodeValue(in, rv.Index(i), "")
+		}
+	case reflect.Map:
+		decodeMap(in, rv)
+	case reflect.String:
+		rv.SetString(in.ReadString())
+	case reflect.Bool:
+		rv.SetBool(in.ReadUint8() != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		decodeInt(in, rv, tag)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		decodeUint(in, rv, tag)
+	case reflect.Float32:
+		rv.SetFloat(float64(in.ReadFloat32()))
+	case reflect.Float64:
+		rv.SetFloat(in.ReadFloat64())
+	default:
+		panic(EUnsupportedType)
+	}
+}
+
+func decodeStruct(in Input, rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("packed")
+		if tag == "skip" {
+			continue
+		}
+		decodeValue(in, rv.Field(i), tag)
+	}
+}
+
+func decodeMap(in Input, rv reflect.Value) {
+	length := in.ReadVarUint32()
+	in.checkLength(length)
+	mapType := rv.Type()
+	m := reflect.MakeMapWithSize(mapType, int(length))
+	for i := 0; i < int(length); i++ {
+		key := reflect.New(mapType.Key()).Elem()
+		decodeValue(in, key, "")
+		value := reflect.New(mapType.Elem()).Elem()
+		decodeValue(in, value, "")
+		m.SetMapIndex(key, value)
+	}
+	rv.Set(m)
+}
+
+func decodeInt(in Input, rv reflect.Value, tag string) {
+	switch tag {
+	case "zigzag":
+		if rv.Type().Bits() > 32 {
+			rv.SetInt(in.ReadVarInt64())
+		} else {
+			rv.SetInt(int64(in.ReadVarInt32()))
+		}
+	case "varint":
+		if rv.Type().Bits() > 32 {
+			rv.SetInt(int64(in.ReadVarUint64()))
+		} else {
+			rv.SetInt(int64(int32(in.ReadVarUint32())))
+		}
+	case "fixed32":
+		rv.SetInt(int64(in.ReadInt32()))
+	case "fixed64":
+		rv.SetInt(in.ReadInt64())
+	default:
+		switch rv.Type().Bits() {
+		case 8:
+			rv.SetInt(int64(in.ReadInt8()))
+		case 16:
+			rv.SetInt(int64(in.ReadInt16()))
+		case 32:
+			rv.SetInt(int64(in.ReadInt32()))
+		default:
+			rv.SetInt(in.ReadInt64())
+		}
+	}
+}
+
+func decodeUint(in Input, rv reflect.Value, tag string) {
+	switch tag {
+	case "varint", "zigzag":
+		if rv.Type().Bits() > 32 {
+			rv.SetUint(in.ReadVarUint64())
+		} else {
+			rv.SetUint(uint64(in.ReadVarUint32()))
+		}
+	case "fixed32":
+		rv.SetUint(uint64(in.ReadUint32()))
+	case "fixed64":
+		rv.SetUint(in.ReadUint64())
+	default:
+		switch rv.Type().Bits() {
+		case 8:
+			rv.SetUint(uint64(in.ReadUint8()))
+		case 16:
+			rv.SetUint(uint64(in.ReadUint16()))
+		case 32:
+			rv.SetUint(uint64(in.ReadUint32()))
+		default:
+			rv.SetUint(in.ReadUint64())
+		}
+	}
+}
+
+// isByteSlice reports whether t's element type is byte; t may be a slice
+// or an array.
+func isByteSlice(t reflect.Type) bool {
+	return t.Elem().Kind() == reflect.Uint8
+}
+
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
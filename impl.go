@@ -14,12 +14,63 @@ var EOS = errors.New("End of stream")
 // Thrown when the length of the string is greater than MAX_UINT32
 var EOverflow = errors.New("Overflow")
 
-type Input struct{ reader io.Reader }
+// Thrown when a length prefix exceeds the Input's configured MaxElements, or
+// the limit passed to ReadStringMax.
+var ETooLarge = errors.New("Length prefix exceeds configured maximum")
+
+type Input struct {
+	reader      io.Reader
+	br          io.ByteReader
+	maxElements uint32 // 0 means unlimited
+}
 type Output struct{ writer io.Writer }
 
-func MakeInput(reader io.Reader) Input   { return Input{reader} }
+// singleByteReader adapts an io.Reader to io.ByteReader one byte at a time,
+// via the same Read calls the reader would otherwise get - unlike a
+// bufio.Reader it never reads ahead, so it can't steal bytes that belong to
+// whatever the caller reads from the same stream next.
+type singleByteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (s *singleByteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(s.r, s.buf[:])
+	if err != nil {
+		return 0, err
+	}
+	return s.buf[0], nil
+}
+
+// MakeInput wraps reader in an Input. If reader doesn't already implement
+// io.ByteReader, the varint readers fall back to reading one byte at a
+// time from reader directly (via singleByteReader) rather than through a
+// bufio.Reader, since a bufio.Reader would read ahead into bytes that don't
+// belong to this message on a shared stream like a net.Conn.
+func MakeInput(reader io.Reader) Input {
+	br, ok := reader.(io.ByteReader)
+	if !ok {
+		br = &singleByteReader{r: reader}
+	}
+	return Input{reader: reader, br: br}
+}
 func MakeOutput(writer io.Writer) Output { return Output{writer} }
 
+// WithMaxElements returns a copy of in that rejects any length prefix
+// (string, bytes, array or object) greater than max before allocating,
+// guarding against hostile inputs that claim a huge length. max == 0 means
+// unlimited, which is the default.
+func (in Input) WithMaxElements(max uint32) Input {
+	in.maxElements = max
+	return in
+}
+
+func (in Input) checkLength(length uint32) {
+	if in.maxElements > 0 && length > in.maxElements {
+		panic(ETooLarge)
+	}
+}
+
 func InputFromBuffer(buf []byte) Input {
 	reader := bytes.NewReader(buf)
 	return MakeInput(reader)
@@ -110,12 +161,10 @@ func (in Input) ReadInt64() int64 {
 func (in Input) ReadVarUint32() (value uint32) {
 	offset := uint(0)
 	for {
-		var buf [1]byte
-		_, err := io.ReadFull(in.reader, buf[:])
+		ch, err := in.br.ReadByte()
 		if err != nil {
 			panic(err)
 		}
-		ch := uint8(buf[0])
 		value |= uint32(ch&0x7F) << offset
 		offset += 7
 		if ch&0x80 == 0 {
@@ -125,23 +174,16 @@ func (in Input) ReadVarUint32() (value uint32) {
 }
 
 func (in Input) ReadVarInt32() (value int32) {
-	raw := in.ReadVarUint32()
-	value = int32(raw >> 1)
-	if raw&1 > 0 {
-		value = ^value
-	}
-	return
+	return ReadZigZag32(in.ReadVarUint32())
 }
 
 func (in Input) ReadVarUint64() (value uint64) {
 	offset := uint(0)
 	for {
-		var buf [1]byte
-		_, err := io.ReadFull(in.reader, buf[:])
+		ch, err := in.br.ReadByte()
 		if err != nil {
 			panic(err)
 		}
-		ch := uint8(buf[0])
 		value |= uint64(ch&0x7F) << offset
 		offset += 7
 		if ch&0x80 == 0 {
@@ -151,12 +193,7 @@ func (in Input) ReadVarUint64() (value uint64) {
 }
 
 func (in Input) ReadVarInt64() (value int64) {
-	raw := in.ReadVarUint64()
-	value = int64(raw >> 1)
-	if raw&1 > 0 {
-		value = ^value
-	}
-	return
+	return ReadZigZag64(in.ReadVarUint64())
 }
 
 func (in Input) ReadFloat32() float32 {
@@ -169,6 +206,26 @@ func (in Input) ReadFloat64() float64 {
 
 func (in Input) ReadString() string {
 	length := in.ReadVarUint32()
+	in.checkLength(length)
+	buffer := make([]byte, length)
+	ex, err := io.ReadFull(in.reader, buffer)
+	if err != nil {
+		panic(err)
+	}
+	if uint32(ex) != length {
+		panic(EOS)
+	}
+	return string(buffer[:length])
+}
+
+// ReadStringMax reads a length-prefixed string, rejecting it before
+// allocating if its length exceeds limit, regardless of the Input's
+// configured MaxElements.
+func (in Input) ReadStringMax(limit uint32) string {
+	length := in.ReadVarUint32()
+	if length > limit {
+		panic(ETooLarge)
+	}
 	buffer := make([]byte, length)
 	ex, err := io.ReadFull(in.reader, buffer)
 	if err != nil {
@@ -182,6 +239,7 @@ func (in Input) ReadString() string {
 
 func (in Input) ReadBytes() []byte {
 	length := in.ReadVarUint32()
+	in.checkLength(length)
 	buffer := make([]byte, length)
 	ex, err := io.ReadFull(in.reader, buffer)
 	if err != nil {
@@ -193,6 +251,19 @@ func (in Input) ReadBytes() []byte {
 	return buffer[:length]
 }
 
+// ReadBytesInto reads a length-prefixed byte string into the caller-owned
+// buf instead of allocating, and returns the number of bytes read. It
+// panics with EOverflow if the prefixed length exceeds len(buf).
+func (in Input) ReadBytesInto(buf []byte) int {
+	length := in.ReadVarUint32()
+	in.checkLength(length)
+	if uint64(length) > uint64(len(buf)) {
+		panic(EOverflow)
+	}
+	in.ReadFixedBytes(buf[:length])
+	return int(length)
+}
+
 func (in Input) ReadFixedBytes(buffer []byte) {
 	ex, err := io.ReadFull(in.reader, buffer)
 	if err != nil {
@@ -205,6 +276,7 @@ func (in Input) ReadFixedBytes(buffer []byte) {
 
 func (in Input) IterateArray(sizefn func(length int), fn func(i int)) {
 	length := in.ReadVarUint32()
+	in.checkLength(length)
 	if sizefn != nil {
 		sizefn(int(length))
 	}
@@ -215,12 +287,47 @@ func (in Input) IterateArray(sizefn func(length int), fn func(i int)) {
 
 func (in Input) IterateObject(fn func(key string)) {
 	length := in.ReadVarUint32()
+	in.checkLength(length)
 	for i := 0; i < int(length); i++ {
 		key := in.ReadString()
 		fn(key)
 	}
 }
 
+// IterateArrayErr is the error-returning counterpart to IterateArray: sizefn
+// and fn may return an error to stop the iteration early (e.g. on
+// validation failure) without panicking through the caller's stack.
+func (in Input) IterateArrayErr(sizefn func(length int) error, fn func(i int) error) error {
+	length := in.ReadVarUint32()
+	in.checkLength(length)
+	if sizefn != nil {
+		if err := sizefn(int(length)); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < int(length); i++ {
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IterateObjectErr is the error-returning counterpart to IterateObject: fn
+// may return an error to stop the iteration early without panicking
+// through the caller's stack.
+func (in Input) IterateObjectErr(fn func(key string) error) error {
+	length := in.ReadVarUint32()
+	in.checkLength(length)
+	for i := 0; i < int(length); i++ {
+		key := in.ReadString()
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (out Output) WriteUint8(value uint8) {
 	_, err := out.writer.Write([]byte{byte(value)})
 	if err != nil {
@@ -289,64 +396,72 @@ func (out Output) WriteInt64(value int64) {
 	}
 }
 
+// writeScratch flushes a varint's bytes in a single Write call instead of
+// one Write per byte. If the underlying writer is a *bytes.Buffer (as
+// returned by NewOutput), it's grown up front to absorb buf without an
+// intermediate reallocation.
+func (out Output) writeScratch(buf []byte) {
+	if bb, ok := out.writer.(*bytes.Buffer); ok {
+		bb.Grow(len(buf))
+	}
+	_, err := out.writer.Write(buf)
+	if err != nil {
+		panic(err)
+	}
+}
+
 func (out Output) WriteVarUint32(value uint32) {
+	var scratch [5]byte
+	n := 0
 	for {
 		temp := uint8(value & 0x7F)
 		value >>= 7
 		if value != 0 {
 			temp |= 0x80
 		}
-		_, err := out.writer.Write([]byte{byte(temp)})
-		if err != nil {
-			panic(err)
-		}
+		scratch[n] = temp
+		n++
 		if value == 0 {
-			return
+			break
 		}
 	}
+	out.writeScratch(scratch[:n])
 }
 
 func (out Output) WriteVarInt32(value int32) {
-	temp := uint32(value) << 1
-	if value < 0 {
-		temp = ^temp
-	}
-	out.WriteVarUint32(temp)
+	out.WriteVarUint32(WriteZigZag32(value))
 }
 
 func (out Output) WriteVarUint64(value uint64) {
+	var scratch [10]byte
+	n := 0
 	for {
 		temp := uint8(value & 0x7F)
 		value >>= 7
 		if value != 0 {
 			temp |= 0x80
 		}
-		_, err := out.writer.Write([]byte{byte(temp)})
-		if err != nil {
-			panic(err)
-		}
+		scratch[n] = temp
+		n++
 		if value == 0 {
-			return
+			break
 		}
 	}
+	out.writeScratch(scratch[:n])
 }
 
 func (out Output) WriteVarInt64(value int64) {
-	temp := uint64(value) << 1
-	if value < 0 {
-		temp = ^temp
-	}
-	out.WriteVarUint64(temp)
+	out.WriteVarUint64(WriteZigZag64(value))
 }
 
 func (out Output) WriteFloat32(value float32) {
 	temp := math.Float32bits(value)
-	out.WriteVarUint32(temp)
+	out.WriteUint32(temp)
 }
 
 func (out Output) WriteFloat64(value float64) {
 	temp := math.Float64bits(value)
-	out.WriteVarUint64(temp)
+	out.WriteUint64(temp)
 }
 
 func (out Output) WriteString(value string) {
@@ -0,0 +1,291 @@
+package packed
+
+import "io"
+
+// stickyReader wraps an io.Reader and remembers the first error it saw,
+// turning every subsequent Read into a no-op that returns that error.
+type stickyReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (s *stickyReader) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// stickyWriter wraps an io.Writer and remembers the first error it saw,
+// turning every subsequent Write into a no-op that returns that error.
+type stickyWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (s *stickyWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// SafeInput is an error-propagating counterpart to Input: instead of
+// panicking, it records the first error it encounters and turns every
+// subsequent Read* call into a no-op returning the zero value.
+type SafeInput struct {
+	in  Input
+	cnt *stickyReader
+}
+
+// MakeSafeInput wraps reader in a SafeInput.
+func MakeSafeInput(reader io.Reader) SafeInput {
+	cnt := &stickyReader{r: reader}
+	return SafeInput{in: MakeInput(cnt), cnt: cnt}
+}
+
+// Err returns the first error encountered, if any.
+func (s SafeInput) Err() error { return s.cnt.err }
+
+// N returns the number of bytes successfully read so far.
+func (s SafeInput) N() int64 { return s.cnt.n }
+
+// guard runs fn, turning any panic raised by the underlying Input into a
+// sticky error instead of letting it propagate.
+func (s SafeInput) guard(fn func()) {
+	if s.cnt.err != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			if s.cnt.err == nil {
+				s.cnt.err = err
+			}
+		}
+	}()
+	fn()
+}
+
+func (s SafeInput) ReadUint8() (value uint8) {
+	s.guard(func() { value = s.in.ReadUint8() })
+	return
+}
+
+func (s SafeInput) ReadInt8() (value int8) {
+	s.guard(func() { value = s.in.ReadInt8() })
+	return
+}
+
+func (s SafeInput) ReadUint16() (value uint16) {
+	s.guard(func() { value = s.in.ReadUint16() })
+	return
+}
+
+func (s SafeInput) ReadInt16() (value int16) {
+	s.guard(func() { value = s.in.ReadInt16() })
+	return
+}
+
+func (s SafeInput) ReadUint32() (value uint32) {
+	s.guard(func() { value = s.in.ReadUint32() })
+	return
+}
+
+func (s SafeInput) ReadInt32() (value int32) {
+	s.guard(func() { value = s.in.ReadInt32() })
+	return
+}
+
+func (s SafeInput) ReadUint64() (value uint64) {
+	s.guard(func() { value = s.in.ReadUint64() })
+	return
+}
+
+func (s SafeInput) ReadInt64() (value int64) {
+	s.guard(func() { value = s.in.ReadInt64() })
+	return
+}
+
+func (s SafeInput) ReadVarUint32() (value uint32) {
+	s.guard(func() { value = s.in.ReadVarUint32() })
+	return
+}
+
+func (s SafeInput) ReadVarInt32() (value int32) {
+	s.guard(func() { value = s.in.ReadVarInt32() })
+	return
+}
+
+func (s SafeInput) ReadVarUint64() (value uint64) {
+	s.guard(func() { value = s.in.ReadVarUint64() })
+	return
+}
+
+func (s SafeInput) ReadVarInt64() (value int64) {
+	s.guard(func() { value = s.in.ReadVarInt64() })
+	return
+}
+
+func (s SafeInput) ReadFloat32() (value float32) {
+	s.guard(func() { value = s.in.ReadFloat32() })
+	return
+}
+
+func (s SafeInput) ReadFloat64() (value float64) {
+	s.guard(func() { value = s.in.ReadFloat64() })
+	return
+}
+
+func (s SafeInput) ReadString() (value string) {
+	s.guard(func() { value = s.in.ReadString() })
+	return
+}
+
+func (s SafeInput) ReadBytes() (value []byte) {
+	s.guard(func() { value = s.in.ReadBytes() })
+	return
+}
+
+func (s SafeInput) ReadFixedBytes(buffer []byte) {
+	s.guard(func() { s.in.ReadFixedBytes(buffer) })
+}
+
+// SafeLoad lets a Serializable participate in the sticky-error model: it
+// calls v.Load through this SafeInput, turning any panic v.Load triggers
+// (directly or via the Input it's handed) into a sticky error like every
+// other SafeInput method.
+func (s SafeInput) SafeLoad(v Serializable) {
+	s.guard(func() { v.Load(s.in) })
+}
+
+// SafeOutput is an error-propagating counterpart to Output: instead of
+// panicking, it records the first error it encounters and turns every
+// subsequent Write* call into a no-op.
+type SafeOutput struct {
+	out Output
+	cnt *stickyWriter
+}
+
+// MakeSafeOutput wraps writer in a SafeOutput.
+func MakeSafeOutput(writer io.Writer) SafeOutput {
+	cnt := &stickyWriter{w: writer}
+	return SafeOutput{out: MakeOutput(cnt), cnt: cnt}
+}
+
+// Err returns the first error encountered, if any.
+func (s SafeOutput) Err() error { return s.cnt.err }
+
+// N returns the number of bytes successfully written so far.
+func (s SafeOutput) N() int64 { return s.cnt.n }
+
+// guard runs fn, turning any panic raised by the underlying Output into a
+// sticky error instead of letting it propagate.
+func (s SafeOutput) guard(fn func()) {
+	if s.cnt.err != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			if s.cnt.err == nil {
+				s.cnt.err = err
+			}
+		}
+	}()
+	fn()
+}
+
+func (s SafeOutput) WriteUint8(value uint8) {
+	s.guard(func() { s.out.WriteUint8(value) })
+}
+
+func (s SafeOutput) WriteInt8(value int8) {
+	s.guard(func() { s.out.WriteInt8(value) })
+}
+
+func (s SafeOutput) WriteUint16(value uint16) {
+	s.guard(func() { s.out.WriteUint16(value) })
+}
+
+func (s SafeOutput) WriteInt16(value int16) {
+	s.guard(func() { s.out.WriteInt16(value) })
+}
+
+func (s SafeOutput) WriteUint32(value uint32) {
+	s.guard(func() { s.out.WriteUint32(value) })
+}
+
+func (s SafeOutput) WriteInt32(value int32) {
+	s.guard(func() { s.out.WriteInt32(value) })
+}
+
+func (s SafeOutput) WriteUint64(value uint64) {
+	s.guard(func() { s.out.WriteUint64(value) })
+}
+
+func (s SafeOutput) WriteInt64(value int64) {
+	s.guard(func() { s.out.WriteInt64(value) })
+}
+
+func (s SafeOutput) WriteVarUint32(value uint32) {
+	s.guard(func() { s.out.WriteVarUint32(value) })
+}
+
+func (s SafeOutput) WriteVarInt32(value int32) {
+	s.guard(func() { s.out.WriteVarInt32(value) })
+}
+
+func (s SafeOutput) WriteVarUint64(value uint64) {
+	s.guard(func() { s.out.WriteVarUint64(value) })
+}
+
+func (s SafeOutput) WriteVarInt64(value int64) {
+	s.guard(func() { s.out.WriteVarInt64(value) })
+}
+
+func (s SafeOutput) WriteFloat32(value float32) {
+	s.guard(func() { s.out.WriteFloat32(value) })
+}
+
+func (s SafeOutput) WriteFloat64(value float64) {
+	s.guard(func() { s.out.WriteFloat64(value) })
+}
+
+func (s SafeOutput) WriteString(value string) {
+	s.guard(func() { s.out.WriteString(value) })
+}
+
+func (s SafeOutput) WriteBytes(value []byte) {
+	s.guard(func() { s.out.WriteBytes(value) })
+}
+
+func (s SafeOutput) WriteFixedBytes(value []byte) {
+	s.guard(func() { s.out.WriteFixedBytes(value) })
+}
+
+// SafeSave lets a Serializable participate in the sticky-error model: it
+// calls v.Save through this SafeOutput, turning any panic v.Save triggers
+// (directly or via the Output it's handed) into a sticky error like every
+// other SafeOutput method.
+func (s SafeOutput) SafeSave(v Serializable) {
+	s.guard(func() { v.Save(s.out) })
+}
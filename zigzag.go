@@ -0,0 +1,43 @@
+package packed
+
+// WriteZigZag32 and ReadZigZag32/64 expose the zig-zag transform that
+// ReadVarInt32/64 and WriteVarInt32/64 apply internally, so callers
+// implementing a Protobuf-compatible (or otherwise zig-zag) wire format can
+// apply it to a value read or written through some other path, e.g. a plain
+// WriteVarUint32/ReadVarUint32.
+
+// WriteZigZag32 maps a signed value to its zig-zag encoded unsigned form.
+func WriteZigZag32(value int32) uint32 {
+	temp := uint32(value) << 1
+	if value < 0 {
+		temp = ^temp
+	}
+	return temp
+}
+
+// ReadZigZag32 is the inverse of WriteZigZag32.
+func ReadZigZag32(raw uint32) int32 {
+	value := int32(raw >> 1)
+	if raw&1 > 0 {
+		value = ^value
+	}
+	return value
+}
+
+// WriteZigZag64 maps a signed value to its zig-zag encoded unsigned form.
+func WriteZigZag64(value int64) uint64 {
+	temp := uint64(value) << 1
+	if value < 0 {
+		temp = ^temp
+	}
+	return temp
+}
+
+// ReadZigZag64 is the inverse of WriteZigZag64.
+func ReadZigZag64(raw uint64) int64 {
+	value := int64(raw >> 1)
+	if raw&1 > 0 {
+		value = ^value
+	}
+	return value
+}